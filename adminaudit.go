@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handleAdminInvites serves GET /admin/invites?since=<RFC3339>&email_hash=<hex>
+// returning paginated audit log entries. since defaults to 30 days ago
+// when omitted.
+func handleAdminInvites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	filter := AuditFilter{
+		Since:     time.Now().AddDate(0, 0, -30),
+		EmailHash: r.URL.Query().Get("email_hash"),
+	}
+	if since := r.URL.Query().Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, "invalid since, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		filter.Since = t
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = n
+	}
+
+	entries, err := auditStore.Query(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// AuditEntry is one recorded invite attempt. Emails are stored hashed
+// so the audit log itself isn't a second source of PII to protect.
+type AuditEntry struct {
+	Timestamp     time.Time
+	EmailHash     string
+	IP            string
+	UserAgent     string
+	CaptchaResult string
+	SlackResponse string
+	Error         string
+}
+
+// AuditFilter narrows an audit query to a time range and/or a single
+// hashed email, for the de-duplication and abuse-investigation use
+// cases GET /admin/invites exists for.
+type AuditFilter struct {
+	Since     time.Time
+	EmailHash string
+	Limit     int
+	Offset    int
+}
+
+// AuditStore persists invite attempts across restarts, since the
+// expvar counters reset on every deploy.
+type AuditStore interface {
+	Record(ctx context.Context, entry AuditEntry) error
+	Query(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+	Purge(ctx context.Context, olderThan time.Time) (int64, error)
+}
+
+// hashEmail is the one-way transform applied to an email before it's
+// ever written to the audit store.
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(email))
+	return hex.EncodeToString(sum[:])
+}
+
+const auditSchema = `
+CREATE TABLE IF NOT EXISTS invite_audit (
+	timestamp      TIMESTAMP NOT NULL,
+	email_hash     TEXT NOT NULL,
+	ip             TEXT NOT NULL,
+	user_agent     TEXT NOT NULL,
+	captcha_result TEXT NOT NULL,
+	slack_response TEXT NOT NULL,
+	error          TEXT NOT NULL
+)`
+
+// sqlAuditStore is a database/sql-backed AuditStore shared by the
+// SQLite and Postgres backends; the only difference between them is
+// the driver name and placeholder style used in queries.
+type sqlAuditStore struct {
+	db             *sql.DB
+	pgPlaceholders bool
+}
+
+// newSQLiteAuditStore opens (creating if necessary) a SQLite database
+// at path and is the default AuditStore.
+func newSQLiteAuditStore(path string) (AuditStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	store := &sqlAuditStore{db: db}
+	if _, err := db.Exec(auditSchema); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// newPostgresAuditStore opens a Postgres database at the given DSN.
+func newPostgresAuditStore(dsn string) (AuditStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	store := &sqlAuditStore{db: db, pgPlaceholders: true}
+	if _, err := db.Exec(auditSchema); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// newAuditStore picks an AuditStore implementation based on driver
+// ("sqlite", the default, or "postgres").
+func newAuditStore(driver, dsn string) (AuditStore, error) {
+	switch driver {
+	case "", "sqlite":
+		return newSQLiteAuditStore(dsn)
+	case "postgres":
+		return newPostgresAuditStore(dsn)
+	default:
+		return nil, fmt.Errorf("auditstore: unknown AUDIT_STORE_DRIVER %q", driver)
+	}
+}
+
+// placeholder returns the nth bind parameter in the dialect this store
+// was opened with: "?" for SQLite, "$n" for Postgres.
+func (s *sqlAuditStore) placeholder(n int) string {
+	if s.pgPlaceholders {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+func (s *sqlAuditStore) Record(ctx context.Context, e AuditEntry) error {
+	query := fmt.Sprintf(
+		`INSERT INTO invite_audit (timestamp, email_hash, ip, user_agent, captcha_result, slack_response, error)
+		 VALUES (%s, %s, %s, %s, %s, %s, %s)`,
+		s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4),
+		s.placeholder(5), s.placeholder(6), s.placeholder(7),
+	)
+	_, err := s.db.ExecContext(ctx, query, e.Timestamp, e.EmailHash, e.IP, e.UserAgent, e.CaptchaResult, e.SlackResponse, e.Error)
+	return err
+}
+
+func (s *sqlAuditStore) Query(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	query := `SELECT timestamp, email_hash, ip, user_agent, captcha_result, slack_response, error
+	          FROM invite_audit WHERE timestamp >= ` + s.placeholder(1)
+	args := []interface{}{filter.Since}
+	if filter.EmailHash != "" {
+		args = append(args, filter.EmailHash)
+		query += fmt.Sprintf(" AND email_hash = %s", s.placeholder(len(args)))
+	}
+	query += " ORDER BY timestamp DESC"
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	args = append(args, limit, filter.Offset)
+	query += fmt.Sprintf(" LIMIT %s OFFSET %s", s.placeholder(len(args)-1), s.placeholder(len(args)))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.Timestamp, &e.EmailHash, &e.IP, &e.UserAgent, &e.CaptchaResult, &e.SlackResponse, &e.Error); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlAuditStore) Purge(ctx context.Context, olderThan time.Time) (int64, error) {
+	query := "DELETE FROM invite_audit WHERE timestamp < " + s.placeholder(1)
+	res, err := s.db.ExecContext(ctx, query, olderThan)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// purgeAuditLog runs store.Purge on a fixed interval, dropping entries
+// older than retention for GDPR compliance, until ctx is cancelled.
+func purgeAuditLog(ctx context.Context, store AuditStore, retention time.Duration) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := store.Purge(ctx, time.Now().Add(-retention))
+			if err != nil {
+				log.Println("error purging audit log:", err)
+				continue
+			}
+			if n > 0 {
+				log.Println("purged", n, "expired audit log entries")
+			}
+		}
+	}
+}
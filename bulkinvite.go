@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bulkInviteConcurrency bounds how many invites handleBulkInvite sends
+// to Slack at once, independent of how many rows were submitted.
+const bulkInviteConcurrency = 5
+
+// bulkInviteMaxAttempts caps retries for a single row before it's
+// reported as failed.
+const bulkInviteMaxAttempts = 5
+
+type bulkInviteRow struct {
+	FName string `json:"fname"`
+	LName string `json:"lname"`
+	Email string `json:"email"`
+}
+
+type bulkInviteResult struct {
+	Row     int    `json:"row"`
+	Email   string `json:"email"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handleBulkInvite accepts a CSV or JSON array of {fname,lname,email}
+// records and invites each with bounded concurrency, retrying on
+// Slack rate limits with the backoff Retry-After tells us to use. It
+// responds with a per-row success/error report.
+func handleBulkInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	rows, err := parseBulkInviteRows(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]bulkInviteResult, len(rows))
+	sem := make(chan struct{}, bulkInviteConcurrency)
+	var wg sync.WaitGroup
+	for i, row := range rows {
+		wg.Add(1)
+		go func(i int, row bulkInviteRow) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = bulkInviteResult{Row: i, Email: row.Email}
+			if err := inviteWithRetry(r.Context(), row); err != nil {
+				results[i].Error = err.Error()
+			} else {
+				results[i].Success = true
+			}
+		}(i, row)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// inviteWithRetry invites row, retrying with the backoff Slack asks
+// for on a 429 (via RateLimitedError.RetryAfter), falling back to a
+// doubling delay if Slack doesn't tell us how long to wait.
+func inviteWithRetry(ctx context.Context, row bulkInviteRow) error {
+	backoff := time.Second
+	var err error
+	for attempt := 0; attempt < bulkInviteMaxAttempts; attempt++ {
+		err = inviter.Invite(ctx, row.FName, row.LName, row.Email)
+		if err == nil {
+			return nil
+		}
+		var rateLimitErr *rateLimitedError
+		if !errors.As(err, &rateLimitErr) {
+			return err
+		}
+		wait := rateLimitErr.RetryAfter
+		if wait <= 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		time.Sleep(wait)
+	}
+	return err
+}
+
+// parseBulkInviteRows reads rows from either a JSON array body
+// (application/json) or a CSV body with an "fname,lname,email" header
+// row (text/csv, the default for anything else).
+func parseBulkInviteRows(r *http.Request) ([]bulkInviteRow, error) {
+	defer r.Body.Close()
+
+	if strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		var rows []bulkInviteRow
+		if err := json.NewDecoder(r.Body).Decode(&rows); err != nil {
+			return nil, err
+		}
+		return rows, nil
+	}
+
+	cr := csv.NewReader(r.Body)
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("empty CSV body")
+		}
+		return nil, err
+	}
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"fname", "lname", "email"} {
+		if _, ok := col[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing required column %q", required)
+		}
+	}
+
+	var rows []bulkInviteRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, bulkInviteRow{
+			FName: record[col["fname"]],
+			LName: record[col["lname"]],
+			Email: record[col["email"]],
+		})
+	}
+	return rows, nil
+}
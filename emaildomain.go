@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// domainFilter is the process-wide email domain allow/deny list. It is
+// nil when EmailDomainListFile is unset, in which case every domain is
+// permitted.
+var domainFilter *emailDomainFilter
+
+// emailDomainFilter checks an email's domain against a loaded list,
+// either as an allowlist (only listed domains may invite) or a
+// denylist (listed domains are blocked, everything else is fine).
+type emailDomainFilter struct {
+	domains map[string]bool
+	allow   bool
+}
+
+// loadEmailDomainList reads one domain per line (blank lines and lines
+// starting with "#" are ignored) from path and builds a filter that
+// operates in allow or deny mode per mode ("allow"/"deny").
+func loadEmailDomainList(path, mode string) (*emailDomainFilter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	allow, err := parseDomainListMode(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &emailDomainFilter{domains: domains, allow: allow}, nil
+}
+
+func parseDomainListMode(mode string) (allow bool, err error) {
+	switch strings.ToLower(mode) {
+	case "", "deny":
+		return false, nil
+	case "allow":
+		return true, nil
+	default:
+		return false, fmt.Errorf("emaildomain: unknown EMAIL_DOMAIN_LIST_MODE %q", mode)
+	}
+}
+
+// Allowed reports whether email's domain may proceed with an invite.
+func (f *emailDomainFilter) Allowed(email string) bool {
+	i := strings.LastIndexByte(email, '@')
+	if i == -1 {
+		return false
+	}
+	domain := strings.ToLower(email[i+1:])
+	listed := f.domains[domain]
+	if f.allow {
+		return listed
+	}
+	return !listed
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Inviter sends a single invite to a prospective member. It exists so
+// handleInvite and the bulk import endpoint share one code path for
+// actually talking to Slack, and so that path can be swapped or mocked
+// independently of the rest of the request handling.
+type Inviter interface {
+	Invite(ctx context.Context, fname, lname, email string) error
+}
+
+const adminUsersInviteURL = "https://slack.com/api/admin.users.invite"
+
+// slackInviter invites new members with the supported admin.users.invite
+// endpoint, replacing the undocumented InviteToTeam call Slack has
+// broken compatibility with repeatedly. No released slack-go/slack
+// version wraps admin.users.invite, so this calls it directly rather
+// than depending on a client method that doesn't exist. DefaultChannels
+// are granted as part of the same call via channel_ids, rather than via
+// a separate conversations.invite per channel.
+type slackInviter struct {
+	httpClient      *http.Client
+	token           string
+	teamID          string
+	defaultChannels []string
+}
+
+func newSlackInviter(token, teamID string, defaultChannels []string) *slackInviter {
+	return &slackInviter{
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		token:           token,
+		teamID:          teamID,
+		defaultChannels: defaultChannels,
+	}
+}
+
+// rateLimitedError is returned when Slack answers a request with
+// HTTP 429, carrying the Retry-After duration it asked us to wait.
+type rateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("slack: rate limited, retry after %s", e.RetryAfter)
+}
+
+// slackAPIResponse is the envelope every Slack Web API method replies
+// with, success or not.
+type slackAPIResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+func (si *slackInviter) Invite(ctx context.Context, fname, lname, email string) error {
+	form := url.Values{
+		"token":     {si.token},
+		"team_id":   {si.teamID},
+		"email":     {email},
+		"real_name": {strings.TrimSpace(fname + " " + lname)},
+	}
+	if len(si.defaultChannels) > 0 {
+		form.Set("channel_ids", strings.Join(si.defaultChannels, ","))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, adminUsersInviteURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := si.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &rateLimitedError{RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+	}
+
+	var apiResp slackAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return err
+	}
+	if !apiResp.OK {
+		return fmt.Errorf("admin.users.invite: %s", apiResp.Error)
+	}
+	return nil
+}
+
+// retryAfter parses a Retry-After header value (seconds), defaulting
+// to 1 second if it's missing or malformed.
+func retryAfter(header string) time.Duration {
+	secs, err := strconv.Atoi(header)
+	if err != nil || secs <= 0 {
+		return time.Second
+	}
+	return time.Duration(secs) * time.Second
+}
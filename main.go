@@ -2,30 +2,31 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"expvar"
 	"fmt"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"strconv"
 	"text/template"
 	"time"
 
-	"github.com/go-recaptcha/recaptcha"
 	"github.com/gorilla/handlers"
 	"github.com/kelseyhightower/envconfig"
-	"github.com/nlopes/slack"
 	"github.com/paulbellamy/ratecounter"
+	"github.com/slack-go/slack"
 )
 
 var indexTemplate = template.Must(template.New("index.tmpl").ParseFiles("templates/index.tmpl"))
 var badgeTemplate = template.Must(template.New("badge.tmpl").ParseFiles("templates/badge.tmpl"))
 
 var (
-	api     *slack.Client
-	captcha *recaptcha.Recaptcha
-	counter *ratecounter.RateCounter
+	api        *slack.Client
+	inviter    Inviter
+	captcha    Challenger
+	auditStore AuditStore
+	counter    *ratecounter.RateCounter
 
 	ourTeam = new(team)
 
@@ -37,6 +38,8 @@ var (
 	missingLastName,
 	missingEmail,
 	missingCoC,
+	domainDenied,
+	rateLimited,
 	successfulCaptcha,
 	failedCaptcha,
 	invalidCaptcha,
@@ -53,7 +56,80 @@ type Specification struct {
 	CaptchaSitekey string `required:"true"`
 	CaptchaSecret  string `required:"true"`
 	SlackToken     string `required:"true"`
-	EnforceHTTPS   bool
+	// SlackSigningSecret enables the /slack/events and /slack/command
+	// webhook routes. It's optional so existing deployments that don't
+	// use the Slack app webhook subsystem keep booting unchanged; when
+	// it's empty those routes aren't registered at all.
+	SlackSigningSecret string
+	EnforceHTTPS       bool
+
+	// CaptchaProvider selects the Challenger implementation: "recaptcha"
+	// (default), "hcaptcha", or "turnstile". Read from CAPTCHA_PROVIDER
+	// rather than SLACKINVITER_CAPTCHA_PROVIDER for easy rotation.
+	CaptchaProvider string `envconfig:"CAPTCHA_PROVIDER" default:"recaptcha"`
+
+	// RateLimitPerMinute caps how many /invite/ requests a single
+	// remote IP may make per minute before getting a 429.
+	RateLimitPerMinute int `default:"30"`
+
+	// TrustProxyCIDRs lists CIDR ranges of reverse proxies allowed to
+	// set X-Forwarded-For. A request arriving directly from an address
+	// outside these ranges has its X-Forwarded-For header ignored
+	// entirely, so client IP derivation (rate limiting, audit logging)
+	// can't be spoofed by an arbitrary client. Empty by default, i.e.
+	// no proxy is trusted.
+	TrustProxyCIDRs []string `envconfig:"TRUST_PROXY_CIDRS"`
+
+	// EmailDomainListFile points at a newline-delimited list of email
+	// domains to allow or deny, interpreted per EmailDomainListMode.
+	// Empty means no domain filtering.
+	EmailDomainListFile string
+	EmailDomainListMode string `default:"deny"`
+
+	// TLSCertFile/TLSKeyFile serve the app directly over TLS. Required
+	// when RequireClientCert is set, since mTLS needs the server to
+	// terminate TLS itself rather than sit behind a proxy.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// ClientCAFile is a PEM bundle of CAs trusted to sign client
+	// certificates for mTLS. RequireClientCert rejects the TLS
+	// handshake outright when no valid client cert is presented;
+	// leaving it false still offers certs for verification but lets
+	// requests without one fall through to the trusted-header check.
+	ClientCAFile      string
+	RequireClientCert bool
+
+	// TrustedHeaderName/TrustedHeaderPattern gate admin routes when the
+	// app runs behind a TLS-terminating proxy that forwards the
+	// client cert's DN in a header, e.g. TrustedHeaderName
+	// "X-SSL-Client-DN" and TrustedHeaderPattern "^CN=admin\\.example\\.com$".
+	// Leaving both mTLS and this unset is fail-closed: requireAdminAuth
+	// then rejects every admin route, including /debug/vars, which was
+	// previously unauthenticated.
+	TrustedHeaderName    string
+	TrustedHeaderPattern string
+
+	// SlackTeamID is the Enterprise Grid team ID new invites are
+	// scoped to when calling admin.users.invite. admin.users.invite is
+	// a Grid-only endpoint and rejects requests with an empty team_id,
+	// so this is required: a single-workspace (non-Grid) deployment
+	// can't use this endpoint and isn't supported by this inviter.
+	SlackTeamID string `required:"true"`
+
+	// DefaultChannels is a comma-separated list of channel IDs every
+	// new invite is granted membership in as part of the invite call.
+	// admin.users.invite requires at least one, so at least one must
+	// be configured; it's validated in init rather than left to fail
+	// invites one at a time at runtime.
+	DefaultChannels []string `required:"true"`
+
+	// AuditStoreDriver selects the AuditStore backend: "sqlite"
+	// (default) or "postgres". AuditStoreDSN is the SQLite file path
+	// or Postgres connection string, respectively.
+	AuditStoreDriver string        `envconfig:"AUDIT_STORE_DRIVER" default:"sqlite"`
+	AuditStoreDSN    string        `envconfig:"AUDIT_STORE_DSN" default:"slackinviter-audit.db"`
+	AuditRetention   time.Duration `envconfig:"AUDIT_RETENTION" default:"2160h"`
 }
 
 func init() {
@@ -61,6 +137,12 @@ func init() {
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	if c.SlackTeamID == "" {
+		log.Fatal("SLACKINVITER_SLACKTEAMID is required: admin.users.invite is a Grid-only endpoint and rejects an empty team_id")
+	}
+	if len(c.DefaultChannels) == 0 {
+		log.Fatal("SLACKINVITER_DEFAULTCHANNELS is required: admin.users.invite requires at least one channel_id")
+	}
 	counter = ratecounter.NewRateCounter(1 * time.Minute)
 	m = expvar.NewMap("metrics")
 	m.Set("hits_per_minute", &hitsPerMinute)
@@ -70,26 +152,77 @@ func init() {
 	m.Set("missing_last_name", &missingLastName)
 	m.Set("missing_email", &missingEmail)
 	m.Set("missing_coc", &missingCoC)
+	m.Set("domain_denied", &domainDenied)
+	m.Set("rate_limited", &rateLimited)
 	m.Set("failed_captcha", &failedCaptcha)
 	m.Set("invalid_captcha", &invalidCaptcha)
 	m.Set("successful_captcha", &successfulCaptcha)
 	m.Set("successful_invites", &successfulInvites)
 	m.Set("active_user_count", &activeUserCount)
 	m.Set("user_count", &userCount)
+	m.Set("captcha_providers", challengerCounters)
+
+	captcha, err = newChallenger(c.CaptchaProvider, c.CaptchaSecret)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	trustedProxyNets, err = parseTrustedProxyCIDRs(c.TrustProxyCIDRs)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	limiter = newIPRateLimiter(c.RateLimitPerMinute)
+
+	if c.EmailDomainListFile != "" {
+		domainFilter, err = loadEmailDomainList(c.EmailDomainListFile, c.EmailDomainListMode)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
 
-	captcha = recaptcha.New(c.CaptchaSecret)
 	api = slack.New(c.SlackToken)
+	inviter = newSlackInviter(c.SlackToken, c.SlackTeamID, c.DefaultChannels)
+
+	auditStore, err = newAuditStore(c.AuditStoreDriver, c.AuditStoreDSN)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 }
 
 func main() {
 	go pollSlack()
+	go purgeAuditLog(context.Background(), auditStore, c.AuditRetention)
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/invite/", handleInvite)
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
 	mux.HandleFunc("/", enforceHTTPSFunc(homepage))
 	mux.HandleFunc("/badge.svg", enforceHTTPSFunc(badge))
-	mux.Handle("/debug/vars", http.DefaultServeMux)
-	err := http.ListenAndServe(":"+c.Port, handlers.CombinedLoggingHandler(os.Stdout, mux))
+	if c.SlackSigningSecret != "" {
+		mux.HandleFunc("/slack/events", handleSlackEvents)
+		mux.HandleFunc("/slack/command", handleSlackCommand)
+	}
+	mux.Handle("/debug/vars", requireAdminAuth(http.DefaultServeMux))
+	mux.Handle("/metrics", metricsHandler)
+	mux.Handle("/admin/invite/bulk", requireAdminAuth(http.HandlerFunc(handleBulkInvite)))
+	mux.Handle("/admin/invites", requireAdminAuth(http.HandlerFunc(handleAdminInvites)))
+
+	server := &http.Server{
+		Addr:    ":" + c.Port,
+		Handler: handlers.CombinedLoggingHandler(os.Stdout, mux),
+	}
+
+	var err error
+	if c.ClientCAFile != "" {
+		server.TLSConfig, err = buildMTLSConfig(c.ClientCAFile, c.RequireClientCert)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		err = server.ListenAndServeTLS(c.TLSCertFile, c.TLSKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
 	if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -128,8 +261,7 @@ func updateFromSlack() time.Duration {
 			}
 		}
 	}
-	userCount.Set(uCount)
-	activeUserCount.Set(aCount)
+	setUserCounts(uCount, aCount)
 
 	st, err := api.GetTeamInfo()
 	if err != nil {
@@ -147,7 +279,7 @@ func pollSlack() {
 	}
 }
 
-//Badge renders the sv badge
+// Badge renders the sv badge
 func badge(w http.ResponseWriter, r *http.Request) {
 	leftText := "slack"
 	color := "#E01563"
@@ -230,7 +362,7 @@ func badge(w http.ResponseWriter, r *http.Request) {
 func homepage(w http.ResponseWriter, r *http.Request) {
 	counter.Incr(1)
 	hitsPerMinute.Set(counter.Rate())
-	requests.Add(1)
+	recordRequest()
 
 	var buf bytes.Buffer
 	err := indexTemplate.Execute(
@@ -244,7 +376,7 @@ func homepage(w http.ResponseWriter, r *http.Request) {
 			c.CaptchaSitekey,
 			userCount.String(),
 			activeUserCount.String(),
-			ourTeam,
+			ourTeam.Snapshot(),
 		},
 	)
 	if err != nil {
@@ -263,57 +395,114 @@ func handleInvite(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
-	captchaResponse := r.FormValue("g-recaptcha-response")
-	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		failedCaptcha.Add(1)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	remoteIP := clientIP(r)
+
+	// email, captchaResult and reason are filled in as the request
+	// progresses through validation, and audited on every exit path
+	// (not just a successful invite) so rejected attempts remain
+	// visible for abuse investigation.
+	var email, captchaResult, reason string
+	var inviteErr error
+	defer func() {
+		recordInviteAudit(r, email, captchaResult, reason, inviteErr)
+	}()
+
+	if !limiter.Allow(remoteIP) {
+		recordInviteError("rate_limited")
+		reason = "rate_limited"
+		http.Error(w, "Too many invite attempts, please slow down", http.StatusTooManyRequests)
 		return
 	}
 
-	valid, err := captcha.Verify(captchaResponse, remoteIP)
+	captchaResponse := r.FormValue("g-recaptcha-response")
+	captchaStart := time.Now()
+	valid, err := captcha.Verify(r.Context(), captchaResponse, remoteIP)
+	captchaLatency := time.Since(captchaStart)
 	if err != nil {
-		failedCaptcha.Add(1)
-		http.Error(w, "Error validating recaptcha.. Did you click it?", http.StatusPreconditionFailed)
+		captchaResult, reason = "error", "captcha_error"
+		recordCaptchaOutcome("error", captchaLatency)
+		http.Error(w, "Error validating the captcha.. Did you click it?", http.StatusPreconditionFailed)
 		return
 	}
 	if !valid {
-		invalidCaptcha.Add(1)
-		http.Error(w, "Invalid recaptcha", http.StatusInternalServerError)
+		captchaResult, reason = "invalid", "invalid_captcha"
+		recordCaptchaOutcome("invalid", captchaLatency)
+		http.Error(w, "Invalid captcha", http.StatusInternalServerError)
 		return
 
 	}
-	successfulCaptcha.Add(1)
+	captchaResult = "success"
+	recordCaptchaOutcome("success", captchaLatency)
 	fname := r.FormValue("fname")
 	lname := r.FormValue("lname")
-	email := r.FormValue("email")
+	email = r.FormValue("email")
 	coc := r.FormValue("coc")
 	if email == "" {
-		missingEmail.Add(1)
+		reason = "missing_email"
+		recordInviteError("missing_email")
 		http.Error(w, "Missing email", http.StatusPreconditionFailed)
 		return
 	}
 	if fname == "" {
-		missingFirstName.Add(1)
+		reason = "missing_first_name"
+		recordInviteError("missing_first_name")
 		http.Error(w, "Missing first name", http.StatusPreconditionFailed)
 		return
 	}
 	if lname == "" {
-		missingLastName.Add(1)
+		reason = "missing_last_name"
+		recordInviteError("missing_last_name")
 		http.Error(w, "Missing last name", http.StatusPreconditionFailed)
 		return
 	}
 	if coc != "1" {
-		missingCoC.Add(1)
+		reason = "missing_coc"
+		recordInviteError("missing_coc")
 		http.Error(w, "You need to accept the code of conduct", http.StatusPreconditionFailed)
 		return
 	}
-	err = api.InviteToTeam("Gophers", fname, lname, email)
-	if err != nil {
-		log.Println("InviteToTeam error:", err)
-		inviteErrors.Add(1)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if domainFilter != nil && !domainFilter.Allowed(email) {
+		reason = "domain_denied"
+		recordInviteError("domain_denied")
+		http.Error(w, "This email domain is not permitted to join", http.StatusForbidden)
+		return
+	}
+	inviteStart := time.Now()
+	inviteErr = inviter.Invite(r.Context(), fname, lname, email)
+	if inviteErr != nil {
+		reason = "slack_error"
+		log.Println("invite error:", inviteErr)
+		recordInviteError("slack_error")
+		http.Error(w, inviteErr.Error(), http.StatusInternalServerError)
 		return
 	}
-	successfulInvites.Add(1)
+	recordSuccessfulInvite(time.Since(inviteStart))
+}
+
+// recordInviteAudit persists one row to the audit store for every
+// invite attempt, successful or not, so rate-limited, domain-denied,
+// missing-field and failed-CAPTCHA attempts remain visible to
+// operators investigating abuse, not just completed invites. Failures
+// to write the audit log are logged but don't affect the response,
+// since an audit outage shouldn't block legitimate invites.
+func recordInviteAudit(r *http.Request, email, captchaResult, reason string, inviteErr error) {
+	entry := AuditEntry{
+		Timestamp:     time.Now(),
+		EmailHash:     hashEmail(email),
+		IP:            clientIP(r),
+		UserAgent:     r.UserAgent(),
+		CaptchaResult: captchaResult,
+		SlackResponse: "ok",
+	}
+	if reason != "" {
+		entry.SlackResponse = "rejected"
+		entry.Error = reason
+	}
+	if inviteErr != nil {
+		entry.SlackResponse = "error"
+		entry.Error = inviteErr.Error()
+	}
+	if err := auditStore.Record(r.Context(), entry); err != nil {
+		log.Println("error recording invite audit entry:", err)
+	}
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The Prometheus metrics below mirror the expvar counters declared in
+// main.go. They're populated from the same handful of record* helpers
+// so the two exposition formats can't drift apart.
+var (
+	promRequestsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "slackinviter_requests_total",
+		Help: "Total homepage requests served.",
+	})
+	promInviteErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "slackinviter_invite_errors_total",
+		Help: "Invite attempts that failed, by reason.",
+	}, []string{"reason"})
+	promSuccessfulInvitesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "slackinviter_successful_invites_total",
+		Help: "Invite attempts that succeeded.",
+	})
+	promCaptchaResultTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "slackinviter_captcha_result_total",
+		Help: "CAPTCHA verification outcomes.",
+	}, []string{"result"})
+	promUserCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "slackinviter_user_count",
+		Help: "Current Slack team member count.",
+	})
+	promActiveUserCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "slackinviter_active_user_count",
+		Help: "Current active Slack team member count.",
+	})
+	promInviteLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "slackinviter_invite_duration_seconds",
+		Help:    "Time from an invite POST to the Slack API response.",
+		Buckets: prometheus.DefBuckets,
+	})
+	promCaptchaLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "slackinviter_captcha_verify_duration_seconds",
+		Help:    "Time spent verifying a CAPTCHA token with the provider.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		promRequestsTotal,
+		promInviteErrorsTotal,
+		promSuccessfulInvitesTotal,
+		promCaptchaResultTotal,
+		promUserCount,
+		promActiveUserCount,
+		promInviteLatency,
+		promCaptchaLatency,
+	)
+}
+
+// inviteErrorCounters maps a reason label to the expvar counter it
+// corresponds to, so recordInviteError can keep both exposition
+// formats in sync. Each reason has its own counter so the legacy
+// invite_errors counter keeps its original meaning (a Slack API
+// failure) rather than silently absorbing unrelated rejection reasons.
+var inviteErrorCounters = map[string]*expvar.Int{
+	"missing_first_name": &missingFirstName,
+	"missing_last_name":  &missingLastName,
+	"missing_email":      &missingEmail,
+	"missing_coc":        &missingCoC,
+	"domain_denied":      &domainDenied,
+	"rate_limited":       &rateLimited,
+	"slack_error":        &inviteErrors,
+}
+
+// recordRequest counts a homepage hit in both exposition formats.
+func recordRequest() {
+	requests.Add(1)
+	promRequestsTotal.Inc()
+}
+
+// recordInviteError counts a failed invite attempt under reason, e.g.
+// missing_email, missing_coc, slack_error, rate_limited.
+func recordInviteError(reason string) {
+	if v, ok := inviteErrorCounters[reason]; ok {
+		v.Add(1)
+	}
+	promInviteErrorsTotal.WithLabelValues(reason).Inc()
+}
+
+// recordSuccessfulInvite counts an invite that made it to Slack.
+func recordSuccessfulInvite(latency time.Duration) {
+	successfulInvites.Add(1)
+	promSuccessfulInvitesTotal.Inc()
+	promInviteLatency.Observe(latency.Seconds())
+}
+
+// recordCaptchaOutcome counts a CAPTCHA verification result: "success",
+// "invalid", or "error".
+func recordCaptchaOutcome(result string, latency time.Duration) {
+	switch result {
+	case "success":
+		successfulCaptcha.Add(1)
+	case "invalid":
+		invalidCaptcha.Add(1)
+	case "error":
+		failedCaptcha.Add(1)
+	}
+	promCaptchaResultTotal.WithLabelValues(result).Inc()
+	promCaptchaLatency.Observe(latency.Seconds())
+}
+
+// setUserCounts updates the user/active-user gauges in both exposition
+// formats from a single call site.
+func setUserCounts(total, active int64) {
+	userCount.Set(total)
+	activeUserCount.Set(active)
+	promUserCount.Set(float64(total))
+	promActiveUserCount.Set(float64(active))
+}
+
+// metricsHandler serves the Prometheus exposition format at /metrics.
+var metricsHandler = promhttp.Handler()
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/paulbellamy/ratecounter"
+)
+
+// rateLimitWindow is the rolling window each per-IP counter covers.
+const rateLimitWindow = 1 * time.Minute
+
+// rateLimitIdleExpiry is how long an IP's counter may sit untouched
+// before the janitor reclaims it. Without this, an attacker cycling
+// through spoofed keys (or just many distinct legitimate IPs over
+// time) grows counters without bound.
+const rateLimitIdleExpiry = 10 * time.Minute
+
+// limiter is the process-wide per-IP rate limiter guarding /invite/.
+var limiter *ipRateLimiter
+
+// ipRateLimiterEntry pairs a rolling counter with the last time it was
+// touched, so the janitor can tell which entries are stale.
+type ipRateLimiterEntry struct {
+	rc       *ratecounter.RateCounter
+	lastSeen time.Time
+}
+
+// ipRateLimiter is a token-bucket-style limiter keyed on remote IP,
+// built from the ratecounter package already used for hitsPerMinute.
+// Each IP gets its own rolling one-minute counter; once it exceeds
+// perMinute, further requests are rejected until the window rolls off.
+// A background janitor evicts counters that have gone idle so the map
+// can't be grown without bound by cycling through IPs.
+type ipRateLimiter struct {
+	mu        sync.Mutex
+	perMinute int64
+	counters  map[string]*ipRateLimiterEntry
+}
+
+func newIPRateLimiter(perMinute int) *ipRateLimiter {
+	l := &ipRateLimiter{
+		perMinute: int64(perMinute),
+		counters:  make(map[string]*ipRateLimiterEntry),
+	}
+	go l.janitor()
+	return l
+}
+
+// Allow records a hit for ip and reports whether it is still within
+// the configured per-minute budget. A non-positive perMinute disables
+// rate limiting entirely.
+func (l *ipRateLimiter) Allow(ip string) bool {
+	if l.perMinute <= 0 {
+		return true
+	}
+	now := time.Now()
+	l.mu.Lock()
+	entry, ok := l.counters[ip]
+	if !ok {
+		entry = &ipRateLimiterEntry{rc: ratecounter.NewRateCounter(rateLimitWindow)}
+		l.counters[ip] = entry
+	}
+	entry.lastSeen = now
+	l.mu.Unlock()
+
+	entry.rc.Incr(1)
+	return entry.rc.Rate() <= l.perMinute
+}
+
+// janitor periodically evicts counters that haven't been touched
+// within rateLimitIdleExpiry, bounding memory use to roughly the
+// number of distinct IPs active in that window.
+func (l *ipRateLimiter) janitor() {
+	ticker := time.NewTicker(rateLimitIdleExpiry)
+	defer ticker.Stop()
+	for range ticker.C {
+		cutoff := time.Now().Add(-rateLimitIdleExpiry)
+		l.mu.Lock()
+		for ip, entry := range l.counters {
+			if entry.lastSeen.Before(cutoff) {
+				delete(l.counters, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// maxSignatureAge is how old a Slack request's timestamp may be before
+// we refuse it as a possible replay.
+const maxSignatureAge = 5 * time.Minute
+
+// slackEventEnvelope covers the two envelope shapes the Events API sends
+// us: the one-time URL verification handshake and the regular
+// callback wrapping an inner event.
+type slackEventEnvelope struct {
+	Type      string          `json:"type"`
+	Challenge string          `json:"challenge"`
+	Event     json.RawMessage `json:"event"`
+}
+
+type slackInnerEvent struct {
+	Type string `json:"type"`
+	User string `json:"user"`
+}
+
+// verifySlackSignature checks the X-Slack-Signature header against an
+// HMAC-SHA256 of "v0:timestamp:body" computed with SlackSigningSecret,
+// and rejects requests whose timestamp has drifted too far from now.
+// See https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackSignature(r *http.Request, body []byte) bool {
+	ts := r.Header.Get("X-Slack-Request-Timestamp")
+	sig := r.Header.Get("X-Slack-Signature")
+	if ts == "" || sig == "" {
+		return false
+	}
+	tsInt, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	if math.Abs(time.Since(time.Unix(tsInt, 0)).Seconds()) > maxSignatureAge.Seconds() {
+		return false
+	}
+
+	base := "v0:" + ts + ":" + string(body)
+	mac := hmac.New(sha256.New, []byte(c.SlackSigningSecret))
+	mac.Write([]byte(base))
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(sig))
+}
+
+// handleSlackEvents receives the Slack Events API callback. It answers
+// the one-time URL verification challenge and, on a team_join event,
+// refreshes the user counts immediately rather than waiting for the
+// next pollSlack cycle.
+func handleSlackEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if !verifySlackSignature(r, body) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	var env slackEventEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	switch env.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, env.Challenge)
+		return
+	case "event_callback":
+		var inner slackInnerEvent
+		if err := json.Unmarshal(env.Event, &inner); err != nil {
+			log.Println("error decoding slack event:", err)
+			break
+		}
+		if inner.Type == "team_join" {
+			go updateFromSlack()
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleSlackCommand handles slash commands posted by Slack. Currently
+// only /invite-stats is supported, replying with a snapshot of the
+// expvar counters.
+func handleSlackCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if !verifySlackSignature(r, body) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	switch form.Get("command") {
+	case "/invite-stats":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"response_type":"ephemeral","text":"%s"}`, statsSummary())
+	default:
+		http.Error(w, "unknown command", http.StatusBadRequest)
+	}
+}
+
+// statsSummary renders the current expvar counters as a single line
+// suitable for a slash command reply.
+func statsSummary() string {
+	return fmt.Sprintf(
+		"requests=%s invites=%s errors=%s users=%s active=%s",
+		requests.String(),
+		successfulInvites.String(),
+		inviteErrors.String(),
+		userCount.String(),
+		activeUserCount.String(),
+	)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+// team holds the subset of Slack team info the homepage template
+// renders. Update can now be called concurrently — both pollSlack and
+// the team_join webhook handler refresh it — so all access to Name
+// and Domain is guarded by mu.
+type team struct {
+	mu     sync.RWMutex
+	Name   string
+	Domain string
+}
+
+// Update refreshes the team's fields from a fresh Slack API response.
+func (t *team) Update(info *slack.TeamInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Name = info.Name
+	t.Domain = info.Domain
+}
+
+// Snapshot returns a new *team holding a point-in-time copy of Name
+// and Domain, safe to read (e.g. render into a template) while Update
+// may be running concurrently.
+func (t *team) Snapshot() *team {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return &team{Name: t.Name, Domain: t.Domain}
+}